@@ -0,0 +1,173 @@
+package main
+
+import (
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// defaultEMAHalfLife is used when Config.EMAHalfLifeMinutes is not set.
+const defaultEMAHalfLife = 30 * time.Minute
+
+// defaultFailureCooldown is used when Config.FailureCooldownSeconds is not set.
+const defaultFailureCooldown = 30 * time.Minute
+
+// failureGracePeriod is how long a mining process must stay up after launch for its
+// exit to no longer count as a launch failure against that software/algo combination.
+const failureGracePeriod = 60 * time.Second
+
+// failurePenaltyMultiplier is applied once per recorded failure to a combination's
+// score, on top of the cooldown blacklist, so a combination that is merely flaky
+// (rather than reliably broken) still ranks lower without being fully excluded.
+const failurePenaltyMultiplier = 0.5
+
+// AlgoEMAStat persists the exponentially-weighted moving average profitability score
+// for a (miner, software, algo) combination, smoothing over spot-price noise so the
+// optimizer does not reshuffle on every small fluctuation.
+type AlgoEMAStat struct {
+	ID              uint64 `gorm:"primaryKey"`
+	MinerID         uint64
+	MinerSoftwareID uint64
+	AlgorithmID     uint64
+	EMAScore        float64
+	LastSampleAt    time.Time
+	UpdatedAt       time.Time
+}
+
+// TableName pins the table name explicitly since this is a new table not covered by
+// the shared schema migration.
+func (AlgoEMAStat) TableName() string { return "algo_ema_stats" }
+
+// AlgoFailureState tracks how often a (miner, software, algo) combination has died
+// shortly after launch, so a combination that reliably crashes on an incompatible
+// algo gets penalized or temporarily blacklisted instead of being relaunched every
+// optimization cycle.
+type AlgoFailureState struct {
+	ID              uint64 `gorm:"primaryKey"`
+	MinerID         uint64
+	MinerSoftwareID uint64
+	AlgorithmID     uint64
+	FailureCount    int
+	CooldownUntil   time.Time
+	UpdatedAt       time.Time
+}
+
+// TableName pins the table name explicitly since this is a new table not covered by
+// the shared schema migration.
+func (AlgoFailureState) TableName() string { return "algo_failure_states" }
+
+// emaHalfLife returns the configured half-life, or defaultEMAHalfLife if unset.
+func emaHalfLife(config Config) time.Duration {
+	if config.EMAHalfLifeMinutes <= 0 {
+		return defaultEMAHalfLife
+	}
+	return time.Duration(config.EMAHalfLifeMinutes * float64(time.Minute))
+}
+
+// failureCooldown returns the configured cooldown, or defaultFailureCooldown if unset.
+func failureCooldown(config Config) time.Duration {
+	if config.FailureCooldownSeconds <= 0 {
+		return defaultFailureCooldown
+	}
+	return time.Duration(config.FailureCooldownSeconds) * time.Second
+}
+
+// updateEMAScore folds a freshly-computed raw profitability score into the persisted
+// EMA for this (miner, software, algo) combination, decaying the previous value by how
+// long it has been since the last observation, and returns the updated EMA.
+// @param db - The active database connection
+// @param minerID - The active miner's ID
+// @param minerSoftwareID - The mining software in this combination
+// @param algorithmID - The algorithm in this combination
+// @param rawScore - The latest raw price*profit*work_factor score for this combination
+// @param halfLife - The configured EMA half-life
+// @returns - The updated EMA score
+func updateEMAScore(db *gorm.DB, minerID uint64, minerSoftwareID uint64, algorithmID uint64,
+	rawScore float64, halfLife time.Duration) float64 {
+	var existing AlgoEMAStat
+	db.Where("miner_id = ? AND miner_software_id = ? AND algorithm_id = ?",
+		minerID, minerSoftwareID, algorithmID).Find(&existing)
+	now := time.Now()
+	if existing.ID == 0 {
+		existing = AlgoEMAStat{
+			MinerID: minerID, MinerSoftwareID: minerSoftwareID, AlgorithmID: algorithmID,
+			EMAScore: rawScore, LastSampleAt: now,
+		}
+		db.Create(&existing)
+		return existing.EMAScore
+	}
+	elapsed := now.Sub(existing.LastSampleAt).Seconds()
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	// Standard exponential decay: weight given to the prior EMA shrinks towards zero as
+	// elapsed time passes the half-life.
+	decay := math.Exp(-math.Ln2 * elapsed / halfLife.Seconds())
+	existing.EMAScore = existing.EMAScore*decay + rawScore*(1-decay)
+	existing.LastSampleAt = now
+	db.Save(&existing)
+	return existing.EMAScore
+}
+
+// recordLaunchOutcome checks whether a mining process exited within the failure grace
+// period after being launched, and if so, increments that combination's failure
+// counter and starts a fresh cooldown.
+// @param db - The active database connection
+// @param minerID - The active miner's ID
+// @param minerSoftwareID - The mining software that was launched
+// @param algorithmID - The algorithm that was launched
+// @param launchedAt - When the process was started
+// @param config - The configuration details from the HCL config file
+func recordLaunchOutcome(db *gorm.DB, minerID uint64, minerSoftwareID uint64, algorithmID uint64,
+	launchedAt time.Time, config Config) {
+	if time.Since(launchedAt) >= failureGracePeriod {
+		return // It ran long enough that this exit is not a launch failure.
+	}
+	var state AlgoFailureState
+	db.Where("miner_id = ? AND miner_software_id = ? AND algorithm_id = ?",
+		minerID, minerSoftwareID, algorithmID).Find(&state)
+	state.MinerID = minerID
+	state.MinerSoftwareID = minerSoftwareID
+	state.AlgorithmID = algorithmID
+	state.FailureCount++
+	state.CooldownUntil = time.Now().Add(failureCooldown(config))
+	if state.ID == 0 {
+		db.Create(&state)
+	} else {
+		db.Save(&state)
+	}
+}
+
+// applyFailurePenalty looks up any recorded failure history for a combination and
+// either multiplicatively penalizes its score or reports it as blacklisted for the
+// remainder of its cooldown window. The penalty is temporary, not permanent: once the
+// cooldown has elapsed, FailureCount decays by one each time this is called rather than
+// staying fixed forever, so a combination that is merely flaky eventually recovers to its
+// full score instead of being stuck at a fraction of it for the life of the program.
+// @param db - The active database connection
+// @param minerID - The active miner's ID
+// @param minerSoftwareID - The mining software in this combination
+// @param algorithmID - The algorithm in this combination
+// @param score - The score to penalize
+// @returns - The (possibly penalized) score, and whether the combination is currently blacklisted
+func applyFailurePenalty(db *gorm.DB, minerID uint64, minerSoftwareID uint64, algorithmID uint64,
+	score float64) (float64, bool) {
+	var state AlgoFailureState
+	db.Where("miner_id = ? AND miner_software_id = ? AND algorithm_id = ?",
+		minerID, minerSoftwareID, algorithmID).Find(&state)
+	if state.ID == 0 {
+		return score, false
+	}
+	if time.Now().Before(state.CooldownUntil) {
+		return 0, true
+	}
+	if state.FailureCount > 0 {
+		state.FailureCount--
+		db.Save(&state)
+	}
+	if state.FailureCount == 0 {
+		return score, false
+	}
+	return score * math.Pow(failurePenaltyMultiplier, float64(state.FailureCount)), false
+}
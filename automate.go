@@ -1,14 +1,19 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/exec"
+	"sort"
 	"strings"
-	"syscall"
 	"time"
 
 	"github.com/hashicorp/hcl/v2/hclsimple"
+	"github.com/shirou/gopsutil/host"
+	"github.com/shirou/gopsutil/load"
 	"github.com/shirou/gopsutil/process"
 	"gorm.io/gorm"
 
@@ -16,6 +21,10 @@ import (
 	. "github.com/GregoryUnderscore/Mining-Automation-Shared/models"
 	. "github.com/GregoryUnderscore/Mining-Automation-Shared/utils/email"
 	. "github.com/GregoryUnderscore/Mining-Automation-Shared/utils/pools"
+
+	"github.com/GregoryUnderscore/Mining-Automation/controlserver"
+	"github.com/GregoryUnderscore/Mining-Automation/stats"
+	"github.com/GregoryUnderscore/Mining-Automation/stratum/client"
 )
 
 // ====================================
@@ -30,17 +39,38 @@ type Config struct {
 	Password string `hcl:"password"` // The user's password for login
 	TimeZone string `hcl:"timezone"` // The time zone where the program is run
 
-	// Miner Specific Settings
-	MinerName    string `hcl:"minerName"`    // The name of the mining hardware
-	PoolPassword string `hcl:"poolPassword"` // The password field for the pool
-	Wallet       string `hcl:"wallet"`       // The wallet to use for mining
-	// If this is 1, estimates will be used for optimization instead of 24 hour actual profit.
-	UseEstimates uint8 `hcl:"useEstimates"`
-	// If this is 1, the computer will be rebooted if the mining software dies unexpectedly.
-	RebootOnFailure uint8 `hcl:"rebootOnFailure"`
+	// One block per physical miner managed by this process, e.g.:
+	//   miner { minerName = "Rig1-GPU0" wallet = "..." poolPassword = "x" useEstimates = 1 }
+	// Each runs in its own goroutine against the shared database connection and config below.
+	Miners []MinerConfig `hcl:"miner,block"`
 	// Time in seconds to wait before checking for the next possible optimization.
 	OptimizationCheckTime int `hcl:"optimizationCheckTime"`
 
+	// Excluded time windows during which mining is paused, e.g. peak electricity-rate hours
+	// or overnight when the room needs to be quiet. All windows are inclusive of startTime
+	// and exclusive of endTime.
+	MiningSchedule []ScheduleWindow `hcl:"schedule,block"`
+	// If greater than 0, mining is paused whenever the 1-minute load average exceeds this value.
+	MaxLoadAverage float64 `hcl:"maxLoadAverage,optional"`
+	// If greater than 0, mining is paused whenever any reported sensor temperature (Celsius)
+	// exceeds this value.
+	MaxTemperatureCelsius float64 `hcl:"maxTemperatureCelsius,optional"`
+	// If set, an HTTP control/telemetry API is bound to this address (e.g. "127.0.0.1:9090")
+	// for remote management: GET /miners lists the managed miners, and each miner has
+	// GET /state, POST /pause, POST /resume, POST /switch, GET /candidates and
+	// GET /logs/tail under /miners/<name>/ (e.g. GET /miners/Rig1-GPU0/state).
+	ControlServerAddress string `hcl:"controlServerAddress,optional"`
+	// Shared-secret bearer token required on the mutating control API routes (POST
+	// /pause, /resume, /switch). If unset, those routes are left unprotected, so
+	// ControlServerAddress should then be bound to loopback only (e.g. "127.0.0.1:9090").
+	ControlServerToken string `hcl:"controlServerToken,optional"`
+	// Half-life, in minutes, for the EMA smoothing applied to profitability scores.
+	// Defaults to 30 minutes if unset.
+	EMAHalfLifeMinutes float64 `hcl:"emaHalfLifeMinutes,optional"`
+	// How long, in seconds, a software/algo combination is blacklisted after a launch
+	// failure before it is eligible to be picked again. Defaults to 30 minutes if unset.
+	FailureCooldownSeconds int `hcl:"failureCooldownSeconds,optional"`
+
 	// E-mail Server Settings (SMTP)
 	EmailServer   string `hcl:"emailServer"`
 	EmailPort     string `hcl:"emailPort"`
@@ -50,125 +80,75 @@ type Config struct {
 	EmailTo       string `hcl:"emailTo"`   // The recipient
 }
 
+// MinerConfig holds the settings specific to a single physical miner, repeated once per
+// `miner` block in the config file. Everything else in Config (database, schedule,
+// resource thresholds, EMA/failure tuning, e-mail server) is shared across all of them.
+type MinerConfig struct {
+	MinerName    string `hcl:"minerName"`    // The name of the mining hardware
+	PoolPassword string `hcl:"poolPassword"` // The password field for the pool
+	Wallet       string `hcl:"wallet"`       // The wallet to use for mining
+	// If this is 1, estimates will be used for optimization instead of 24 hour actual profit.
+	UseEstimates uint8 `hcl:"useEstimates"`
+	// If this is 1, the computer will be rebooted if the mining software dies unexpectedly.
+	RebootOnFailure uint8 `hcl:"rebootOnFailure"`
+	// If this is 1, a native Stratum v1 connection is opened directly to the pool instead of
+	// handing the pool URL to the mining software on the command line. Jobs are relayed to the
+	// mining software over its stdin. An algo switch restarts the mining software process and
+	// opens a new Stratum connection to the new algorithm's pool.
+	UseStratumClient uint8 `hcl:"useStratumClient,optional"`
+	// If this is 1, the Stratum connection is wrapped in TLS.
+	UseStratumTLS uint8 `hcl:"useStratumTLS,optional"`
+}
+
+// ScheduleWindow describes a single excluded time-of-day window, repeated on the given days.
+type ScheduleWindow struct {
+	Days      []string `hcl:"days"`      // e.g. ["Mon", "Tue", "Wed", "Thu", "Fri"]
+	StartTime string   `hcl:"startTime"` // 24-hour "HH:MM", in Timezone
+	EndTime   string   `hcl:"endTime"`   // 24-hour "HH:MM", in Timezone
+	Timezone  string   `hcl:"timezone"`  // IANA time zone name, e.g. "America/New_York"
+}
+
 func main() {
 	const configFileName = "Automate.hcl" // The name of the config file
 	var config Config                     // The configuration data will be here
-	var thisMiner Miner                   // The miner that is being optimized
 
 	// Grab the configuration details for the database connection. These are stored in ZergPoolData.hcl.
 	err := hclsimple.DecodeFile(configFileName, nil, &config)
 	if err != nil {
 		log.Fatalf("Failed to load config file "+configFileName+".\n", err)
 	}
+	if len(config.Miners) == 0 {
+		log.Fatalf("Config must define at least one miner block.")
+	}
 
 	// Connect to the database and create/validate the schema.
 	db := Connect(config.Host, config.Port, config.Database, config.User, config.Password,
 		config.TimeZone)
 	VerifyAndUpdateSchema(db)
+	// The EMA/failure-penalty scoring tables are specific to this program and aren't part of
+	// the shared schema, so they're migrated directly here.
+	db.AutoMigrate(&AlgoEMAStat{}, &AlgoFailureState{})
 
-	// Open the new database transaction.
-	tx := db.Begin()
-
-	defer func() { // Ensure transaction rollback on panic
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
-
-	log.Println("Creating records required for operations...")
-	minerID := VerifyMiner(tx, config.MinerName)
-	// Grab the miner record.
-	tx.Where("id = ?", minerID).Find(&thisMiner)
-	if (Miner{}) == thisMiner {
-		log.Fatalf("Unable to locate this miner in the database: " + config.MinerName)
+	// Build a runner for every configured miner, all sharing the database connection and the
+	// rest of the config, and hand them off to the supervisor to run concurrently.
+	supervisor := NewSupervisor(db, config)
+	for _, minerConf := range config.Miners {
+		supervisor.AddRunner(minerConf)
 	}
-	err = tx.Commit().Error // Commit changes to the database
-	if err != nil {
-		log.Fatalf("Issue committing changes.\n", err)
-	}
-
-	// Determine the best software/algorithm for this miner.
-	log.Println("Determining optimal software/algo combination...")
-	bestSoftwareAlgo := getBestSoftwareAlgo(db, minerID, config.UseEstimates)
-	// Generate parameters and get the file path for the first run.
-	params, filePath := changeAlgoGetParams(db, &thisMiner, bestSoftwareAlgo, config)
-	// Kick off the mining software for the first time.
-	proc := openProcess(filePath, params)
-	defer func() { // Ensure process is eliminated on any panic/exit
-		proc.Kill()
-	}()
-
-	secondsSlept := 0      // Tracks the total time slept to know when to check for optimization
-	processCheckTime := 30 // Wait 30 seconds in between activity checks
-	// Endlessly loop and check for better optimizations after the configured time.
-	for {
-		// Time to check for an optimization.
-		if secondsSlept > 0 && (secondsSlept%config.OptimizationCheckTime == 0) {
-			secondsSlept = 0 // Reset
-			optimizationAlgo := getBestSoftwareAlgo(db, minerID, config.UseEstimates)
-			// Is the best algo a change?
-			if optimizationAlgo.ID != thisMiner.MinerSoftwareAlgoID {
-				proc.Kill() // Stop the current mining process.
-				proc.Wait() // Wait for everything to stop. Also releases resources.
-				// Check if the process still exists. There were scenarios where the process
-				// did not stop immediately. It needs to verifiably stop before opening the
-				// next process.
-				exists, _ := process.PidExists(int32(proc.Pid))
-				timesKilled := 0      // Prevent endless loops
-				maxKillNumber := 1000 // Stop after 1,000 attempts
-				for exists {
-					timesKilled++
-					// If attempted to kill it 1,000 times, exit and notify via e-mail
-					// if possible.
-					if timesKilled > maxKillNumber {
-						issue := "Fatal error: Unable to close inferior process " +
-							"after 1,000 attempts."
-						// Send an e-mail notification if the server is set.
-						if len(config.EmailServer) > 0 {
-							SendEmail(issue,
-								"Please review the miner for details and "+
-									"report this issue.",
-								config.EmailUser, config.EmailPassword,
-								config.EmailServer, config.EmailPort,
-								config.EmailTo, config.EmailFrom)
-						}
-						log.Fatal(issue) // Force exit
-					}
-					log.Println("Previous mining process has not stopped. " +
-						"Attempting to kill the process again...")
-					proc.Kill() // Stop the current mining process.
-					proc.Wait() // Wait for everything to stop. Also releases resources.
-					// Give it time to stop.
-					time.Sleep(time.Duration(10) * time.Second)
-					exists, _ = process.PidExists(int32(proc.Pid))
-				}
-				// Generate parameters and get the file path for the next run.
-				// Also, set the active software/algo on the miner.
-				params, filePath = changeAlgoGetParams(db, &thisMiner, optimizationAlgo,
-					config)
-				// Kick off the mining software again.
-				proc = openProcess(filePath, params)
-			}
-		} else {
-			// Wait 30 seconds and then validate the process still exists.
-			time.Sleep(time.Duration(processCheckTime) * time.Second)
-			secondsSlept += processCheckTime
-			exists, _ := process.PidExists(int32(proc.Pid))
-			if exists {
-				// Store a check-in instant to indicate this is still active.
-				checkIn(db, &thisMiner)
-				continue
-			}
-
-			// Process exited probably on error.
-			// Ensure everything has been cleared.
-			proc.Kill() // Stop any current mining process.
-			proc.Wait() // Wait for everything to stop. Also releases resources.
 
-			// Kick off the mining software again.
-			proc = openProcess(filePath, params)
+	if len(config.ControlServerAddress) > 0 {
+		if len(config.ControlServerToken) == 0 {
+			log.Println("Warning: controlServerToken is not set; POST /pause, /resume, and " +
+				"/switch are unprotected. Bind controlServerAddress to loopback only.")
 		}
+		ctrlServer := controlserver.NewServer(config.ControlServerAddress, supervisor.Controllers(),
+			config.ControlServerToken)
+		ctrlServer.Start()
+		defer ctrlServer.Stop()
+		log.Println("Control API listening on " + config.ControlServerAddress)
 	}
+
+	supervisor.Run() // Blocks until every runner's goroutine exits, which normally never happens.
 }
 
 // Change the algorithm on the miner in the database and also generate the parameters necessary for
@@ -176,11 +156,16 @@ func main() {
 // @param db - The active database connect
 // @param miner - A pointer to the active miner. The active algorithm changes, thus pass by reference.
 // @param bestSoftwareAlgo - The optimized algo that should now be used
-// @param config - The configuration details from the HCL config file
+// @param config - The shared configuration details from the HCL config file
+// @param minerConf - The settings specific to this miner (wallet, pool password, name)
+// @param notify - Called with the change notice body instead of sending e-mail directly, so the
+//    supervisor can batch it into a single summary rather than one e-mail per miner
+// @param logFn - Called with a summary of the switch, for GET /logs/tail, or nil to skip
 // @returns - A tuple of parameters for running with the mining software and the file path to the mining
 //    software.
 func changeAlgoGetParams(db *gorm.DB, miner *Miner, bestSoftwareAlgo MinerSoftwareAlgos,
-	config Config) ([]string, string) {
+	config Config, minerConf MinerConfig, notify func(subject string, body string),
+	logFn func(string)) ([]string, string) {
 	var minerSoft MinerSoftware
 	var algo Algorithm
 	var minerSoftDetails MinerMinerSoftware
@@ -206,16 +191,20 @@ func changeAlgoGetParams(db *gorm.DB, miner *Miner, bestSoftwareAlgo MinerSoftwa
 		log.Fatalf("No file path found for miner software: " + minerSoft.Name)
 	}
 	log.Println("Found new optimal software/algorithm...")
-	body := "Software: " + minerSoft.Name + "\r\n" +
+	body := "Miner: " + minerConf.MinerName + "\r\n" +
+		"Software: " + minerSoft.Name + "\r\n" +
 		"Algo: " + algo.Name + "\r\n" +
 		"Changed: " + time.Now().String() + "\r\n"
 	log.Print(body)
+	if logFn != nil {
+		logFn("[" + minerConf.MinerName + "] Switched to " + minerSoft.Name + "/" + algo.Name)
+	}
 	// Pull the latest version of the miner, in case the email setting has changed.
 	tx.First(miner, miner.ID)
-	// Send an e-mail notification if the server is set.
+	// Queue an e-mail notification if the server is set, rather than sending it directly, so
+	// the supervisor can fold it into one combined summary instead of one per miner.
 	if len(config.EmailServer) > 0 && *(miner.SendEmail) {
-		SendEmail(config.MinerName+": New Optimal", body, config.EmailUser, config.EmailPassword,
-			config.EmailServer, config.EmailPort, config.EmailTo, config.EmailFrom)
+		notify(minerConf.MinerName+": New Optimal", body)
 	}
 
 	miner.MinerSoftwareAlgoID = bestSoftwareAlgo.ID
@@ -232,8 +221,13 @@ func changeAlgoGetParams(db *gorm.DB, miner *Miner, bestSoftwareAlgo MinerSoftwa
 	params := []string{minerSoft.Name,
 		minerSoft.AlgoParam, bestSoftwareAlgo.Name,
 		minerSoft.PoolParam, poolURL,
-		minerSoft.WalletParam, config.Wallet,
-		minerSoft.PasswordParam, config.PoolPassword,
+		minerSoft.WalletParam, minerConf.Wallet,
+		minerSoft.PasswordParam, minerConf.PoolPassword,
+	}
+	// With a native Stratum connection the pool is reached through it, so the pool
+	// parameter and URL (params[3] and params[4]) are left off the command line.
+	if minerConf.UseStratumClient == 1 {
+		params = append(params[:3], params[5:]...)
 	}
 	// Process any additional parameters in the catch-all other parameters.
 	if len(minerSoft.OtherParams) > 0 {
@@ -254,21 +248,55 @@ func changeAlgoGetParams(db *gorm.DB, miner *Miner, bestSoftwareAlgo MinerSoftwa
 	return params, minerSoftDetails.FilePath
 }
 
-// Store a check-in instant to indicate that this miner is still active.
+// Store a check-in instant to indicate that this miner is still active, and, when a
+// stats tracker is supplied, write a miner_stats row from actually-observed hashrate
+// rather than waiting on a separate minerStats.exe run.
 // @param db - The active database connection
 // @param thisMiner - The active miner record
-func checkIn(db *gorm.DB, thisMiner *Miner) {
+// @param minerStats - The live stats tracker for the miner's active software/algo, or nil
+func checkIn(db *gorm.DB, thisMiner *Miner, minerStats *stats.Stats) {
 	thisMiner.LastCheckIn = time.Now()
 	db.Save(thisMiner)
+
+	if minerStats == nil {
+		return
+	}
+	var activeAlgo MinerSoftwareAlgos
+	db.Where("id = ?", thisMiner.MinerSoftwareAlgoID).Find(&activeAlgo)
+	if (MinerSoftwareAlgos{}) == activeAlgo {
+		return
+	}
+	state := minerStats.GetMinerState()
+	db.Table("miner_stats").Create(map[string]interface{}{
+		"miner_id":          thisMiner.ID,
+		"miner_software_id": activeAlgo.MinerSoftwareID,
+		"algorithm_id":      activeAlgo.AlgorithmID,
+		"work_per_second":   state.RecentHashrate,
+		"mh_factor":         1, // RecentHashrate is already in raw hashes/second
+	})
 }
 
-// Determine the best software/algo for a miner by examining the most profitable combination.
-// @param tx - The active database connection
+// rawCandidateRow is an unscored software/algo combination straight out of the database,
+// before EMA smoothing and failure penalties are folded in.
+type rawCandidateRow struct {
+	ID              uint64
+	MinerSoftwareID uint64
+	AlgorithmID     uint64
+	SoftwareName    string
+	AlgoName        string
+	RawScore        float64
+	PoolStatAt      time.Time // When the pool stat this candidate was scored on was recorded
+}
+
+// Query every software/algo combination this miner has pool/work stats for, along with
+// a raw price*profit*work_factor score, before any EMA smoothing or failure penalty is
+// applied.
+// @param db - The active database connection
 // @param minerID - The ID for the active miner
 // @param useEstimates - If this is 1, the 24 hour estimate is utilized for profit comparisons. If 0, the
 //    24-hour actuals are used.
-// @returns The best software/algo
-func getBestSoftwareAlgo(db *gorm.DB, minerID uint64, useEstimates uint8) MinerSoftwareAlgos {
+// @returns - The unscored candidates
+func getRawCandidates(db *gorm.DB, minerID uint64, useEstimates uint8) []rawCandidateRow {
 	// Define subquery to get the average work_per_second for the miner/software/algos.
 	subAvgWork :=
 		db.Select("miner_id, miner_software_id, algorithm_id, "+
@@ -289,16 +317,18 @@ func getBestSoftwareAlgo(db *gorm.DB, minerID uint64, useEstimates uint8) MinerS
 			Table("pool_stats")
 
 	// Use estimates to determine profit optimization.
-	orderLogic := "price*profit_estimate*(average_stat.mh_factor / pools.mh_factor)*average_work DESC"
+	rawScoreLogic := "price*profit_estimate*(average_stat.mh_factor / pools.mh_factor)*average_work"
 	// Use 24-hour actuals if the config directs.
 	if useEstimates == 0 {
-		orderLogic = "price*0.001*profit_actual24_hours*(average_stat.mh_factor / pools.mh_factor)*" +
-			"average_work DESC"
+		rawScoreLogic = "price*0.001*profit_actual24_hours*(average_stat.mh_factor / pools.mh_factor)*" +
+			"average_work"
 	}
-	// Get all the mining stats for this miner and ensure they are also linked to a pool.
-	var bestMinerSoftwareAlgo MinerSoftwareAlgos
+	var candidates []rawCandidateRow
 	db.Table("miners").
-		Select("miner_software_algos.*").
+		Select("miner_software_algos.id AS id, latest_stat.miner_software_id AS miner_software_id, "+
+			"latest_stat.algorithm_id AS algorithm_id, miner_softwares.name AS software_name, "+
+			"algorithms.name AS algo_name, "+rawScoreLogic+" AS raw_score, "+
+			"pool_stats.updated_at AS pool_stat_at").
 		Joins("INNER JOIN (?) latest_stat ON latest_stat.miner_id = miners.id", subLatestStat).
 		Joins("INNER JOIN miner_stats ON miner_stats.id = latest_stat.latest_stat_id").
 		Joins("INNER JOIN miner_softwares ON latest_stat.miner_software_id = miner_softwares.id").
@@ -316,33 +346,416 @@ func getBestSoftwareAlgo(db *gorm.DB, minerID uint64, useEstimates uint8) MinerS
 			"AND average_stat.miner_software_id = miner_softwares.id "+
 			"AND average_stat.algorithm_id = algorithms.id", subAvgWork).
 		Where("miners.id = ? AND (do_not_use IS NULL OR do_not_use = FALSE)", minerID).
-		Order(orderLogic).
-		Limit(1).
-		Find(&bestMinerSoftwareAlgo)
-	// Error out if nothing was found. Probably there is not enough statistics in the database.
-	if (MinerSoftwareAlgos{}) == bestMinerSoftwareAlgo {
-		log.Fatalf("Could not determine an optimization for this miner. Try running the pool stats " +
-			"program to load pool statistics (e.g. zerg.exe), or try running the miner " +
-			"statistics program to load miner statistics (i.e. minerStats.exe).")
-	}
-	return bestMinerSoftwareAlgo
+		Find(&candidates)
+	return candidates
+}
+
+// CandidateRow is a single ranked software/algo option along with the smoothed score it
+// was ranked on, for surfacing via the control API's GET /candidates endpoint.
+type CandidateRow struct {
+	ID           uint64
+	SoftwareName string
+	AlgoName     string
+	Score        float64
+	Blacklisted  bool
+	PoolStatAt   time.Time // When the pool stat this candidate was scored on was recorded
+}
+
+// scoreCandidates folds EMA smoothing and the failure penalty/blacklist into each raw
+// candidate's score, and ranks them best-first.
+// @param db - The active database connection
+// @param minerID - The ID for the active miner
+// @param raw - The unscored candidates from getRawCandidates
+// @param config - The configuration details from the HCL config file
+// @returns - The candidates, ranked best-first, each carrying its smoothed score
+func scoreCandidates(db *gorm.DB, minerID uint64, raw []rawCandidateRow, config Config) []CandidateRow {
+	halfLife := emaHalfLife(config)
+	scored := make([]CandidateRow, 0, len(raw))
+	for _, candidate := range raw {
+		ema := updateEMAScore(db, minerID, candidate.MinerSoftwareID, candidate.AlgorithmID,
+			candidate.RawScore, halfLife)
+		penalized, blacklisted := applyFailurePenalty(db, minerID, candidate.MinerSoftwareID,
+			candidate.AlgorithmID, ema)
+		scored = append(scored, CandidateRow{
+			ID: candidate.ID, SoftwareName: candidate.SoftwareName, AlgoName: candidate.AlgoName,
+			Score: penalized, Blacklisted: blacklisted, PoolStatAt: candidate.PoolStatAt,
+		})
+	}
+	sort.Slice(scored, func(i, j int) bool { return scored[i].Score > scored[j].Score })
+	return scored
+}
+
+// Get the ranked software/algo combinations the optimizer considers, EMA-smoothed and
+// failure-penalized, for surfacing via the control API rather than picking silently.
+// @param db - The active database connection
+// @param minerID - The ID for the active miner
+// @param config - The shared configuration details from the HCL config file
+// @param minerConf - The settings specific to this miner (e.g. whether to use estimates)
+// @returns - The candidates, ranked best-first
+func getCandidateSoftwareAlgos(db *gorm.DB, minerID uint64, config Config,
+	minerConf MinerConfig) []CandidateRow {
+	return scoreCandidates(db, minerID, getRawCandidates(db, minerID, minerConf.UseEstimates), config)
+}
+
+// pickBestFromRanked walks an already-ranked candidate list and returns the
+// highest-scoring one that isn't currently blacklisted, shared by getBestSoftwareAlgo and
+// resolveBestAlgoFromRanked so neither has to re-rank a list the caller already has.
+// @param db - The active database connection
+// @param ranked - Candidates as returned by getCandidateSoftwareAlgos/scoreCandidates
+// @returns The best non-blacklisted software/algo
+func pickBestFromRanked(db *gorm.DB, ranked []CandidateRow) MinerSoftwareAlgos {
+	for _, candidate := range ranked {
+		if candidate.Blacklisted {
+			continue
+		}
+		var best MinerSoftwareAlgos
+		db.Where("id = ?", candidate.ID).Find(&best)
+		if (MinerSoftwareAlgos{}) != best {
+			return best
+		}
+	}
+	// Error out if nothing was found. Probably there is not enough statistics in the database,
+	// or every candidate is currently blacklisted after repeated launch failures.
+	log.Fatalf("Could not determine an optimization for this miner. Try running the pool stats " +
+		"program to load pool statistics (e.g. zerg.exe), or try running the miner " +
+		"statistics program to load miner statistics (i.e. minerStats.exe).")
+	return MinerSoftwareAlgos{}
+}
+
+// Determine the best software/algo for a miner by examining the most profitable
+// combination. Profitability is an EMA of price*profit*work_factor over time (so a
+// momentary spot-price spike doesn't cause needless flapping), and any combination
+// that has recently crashed shortly after launch is penalized or, within its cooldown
+// window, skipped entirely.
+// @param db - The active database connection
+// @param minerID - The ID for the active miner
+// @param config - The shared configuration details from the HCL config file
+// @param minerConf - The settings specific to this miner (e.g. whether to use estimates)
+// @returns The best software/algo
+func getBestSoftwareAlgo(db *gorm.DB, minerID uint64, config Config,
+	minerConf MinerConfig) MinerSoftwareAlgos {
+	return pickBestFromRanked(db, getCandidateSoftwareAlgos(db, minerID, config, minerConf))
+}
+
+// Resolve the software/algo that should actually be mined: the operator's manual
+// override from POST /switch if one is set, otherwise whatever the optimizer picks.
+// @param db - The active database connection
+// @param minerID - The ID for the active miner
+// @param config - The shared configuration details from the HCL config file
+// @param minerConf - The settings specific to this miner
+// @param controller - The controller for this miner holding any manual override
+// @returns - The software/algo that should be mined next
+func resolveBestAlgo(db *gorm.DB, minerID uint64, config Config, minerConf MinerConfig,
+	controller *controlserver.MinerController) MinerSoftwareAlgos {
+	if manualID := controller.ManualAlgoID(); manualID != nil {
+		if algo := getSoftwareAlgoByID(db, *manualID); (MinerSoftwareAlgos{}) != algo {
+			return algo
+		}
+		log.Println("Manual algo override refers to an unknown combination; falling back " +
+			"to the optimizer.")
+	}
+	return getBestSoftwareAlgo(db, minerID, config, minerConf)
+}
+
+// resolveBestAlgoFromRanked is resolveBestAlgo for a caller that has already computed the
+// ranked candidate list this tick (e.g. for GET /candidates), so the EMA update and
+// failure-penalty lookup in scoreCandidates don't run a second time for the same tick.
+// @param db - The active database connection
+// @param ranked - Candidates as returned by getCandidateSoftwareAlgos/scoreCandidates
+// @param controller - The controller for this miner holding any manual override
+// @returns - The software/algo that should be mined next
+func resolveBestAlgoFromRanked(db *gorm.DB, ranked []CandidateRow,
+	controller *controlserver.MinerController) MinerSoftwareAlgos {
+	if manualID := controller.ManualAlgoID(); manualID != nil {
+		if algo := getSoftwareAlgoByID(db, *manualID); (MinerSoftwareAlgos{}) != algo {
+			return algo
+		}
+		log.Println("Manual algo override refers to an unknown combination; falling back " +
+			"to the optimizer.")
+	}
+	return pickBestFromRanked(db, ranked)
+}
+
+// poolStatAtFor looks up how recently the pool stat backing a specific ranked
+// candidate's score was observed, for feeding Stats.RecordPoolStat so
+// GetMinerState().PoolStatSecondsOld reflects real staleness instead of always reading
+// as zero.
+// @param ranked - Candidates as returned by getCandidateSoftwareAlgos/scoreCandidates
+// @param minerSoftwareAlgoID - The MinerSoftwareAlgos ID to find the pool-stat instant for
+// @returns - The pool-stat instant, and whether a matching candidate was found
+func poolStatAtFor(ranked []CandidateRow, minerSoftwareAlgoID uint64) (time.Time, bool) {
+	for _, candidate := range ranked {
+		if candidate.ID == minerSoftwareAlgoID {
+			return candidate.PoolStatAt, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// toCandidates converts the ranked, scored rows from getCandidateSoftwareAlgos into the
+// shape the control API serializes.
+func toCandidates(rows []CandidateRow) []controlserver.Candidate {
+	candidates := make([]controlserver.Candidate, 0, len(rows))
+	for _, row := range rows {
+		candidates = append(candidates, controlserver.Candidate{
+			MinerSoftwareAlgoID: row.ID,
+			Software:            row.SoftwareName,
+			Algo:                row.AlgoName,
+			Score:               row.Score,
+			Blacklisted:         row.Blacklisted,
+		})
+	}
+	return candidates
+}
+
+// Look up a specific software/algo combination by ID, for honoring a manual override
+// requested via the control API's POST /switch endpoint.
+// @param db - The active database connection
+// @param id - The MinerSoftwareAlgos ID to load
+// @returns - The matching record, or a zero-value MinerSoftwareAlgos if not found
+func getSoftwareAlgoByID(db *gorm.DB, id uint64) MinerSoftwareAlgos {
+	var algo MinerSoftwareAlgos
+	db.Where("id = ?", id).Find(&algo)
+	return algo
+}
+
+// Open a native Stratum v1 connection directly to the pool for the given algorithm,
+// instead of relying on the mining software's own pool handling. Every dispatched job and
+// difficulty update is written to the returned stdin feed for the child miner process to
+// read, instead of the child being handed a pool URL on the command line, so accept/reject
+// counts come directly from SubmitShare rather than being scraped out of the mining
+// software's log output. If the connection drops unexpectedly, minerStats is marked
+// MINING_PAUSED_NO_CONNECTIVITY so GetMinerState() reports the real reason instead of
+// staying MINING_ACTIVE with a miner that can no longer submit shares.
+// @param db - The active database connection
+// @param algorithmID - The algorithm whose pool should be connected to
+// @param minerConf - The settings specific to this miner (wallet, pool password, TLS)
+// @param minerStats - The stats tracker for the combination about to mine, marked
+//    MINING_PAUSED_NO_CONNECTIVITY if the connection is lost
+// @param logFn - Called with a note when the connection drops, for GET /logs/tail, or
+//    nil to skip
+// @returns - A connected Client and the read end of its job/difficulty feed, or nils if
+//    the connection could not be established
+func openStratumClient(db *gorm.DB, algorithmID uint64, minerConf MinerConfig,
+	minerStats *stats.Stats, logFn func(string)) (*client.Client, io.Reader) {
+	poolURL := GeneratePoolURL(db, algorithmID)
+	stratumConn := client.NewClient(poolURL, minerConf.Wallet, minerConf.PoolPassword,
+		minerConf.UseStratumTLS == 1)
+	stdinReader, stdinWriter := io.Pipe()
+	stratumConn.OnNotify = func(job client.Job) {
+		log.Println("Stratum: new job " + job.JobID)
+		if _, err := io.WriteString(stdinWriter, job.JobLine()); err != nil {
+			log.Println("Unable to dispatch job to miner stdin: " + err.Error())
+		}
+	}
+	stratumConn.OnSetDifficulty = func(difficulty float64) {
+		log.Println("Stratum: pool set difficulty " + fmt.Sprint(difficulty))
+		if _, err := io.WriteString(stdinWriter, client.DifficultyLine(difficulty)); err != nil {
+			log.Println("Unable to dispatch difficulty to miner stdin: " + err.Error())
+		}
+	}
+	stratumConn.OnDisconnect = func(err error) {
+		minerStats.SetState(stats.MINING_PAUSED_NO_CONNECTIVITY)
+		msg := "Stratum connection to pool lost: " + err.Error()
+		if logFn != nil {
+			logFn(msg)
+		}
+	}
+	if err := stratumConn.Connect(); err != nil {
+		log.Println("Unable to open Stratum connection: " + err.Error())
+		return nil, nil
+	}
+	return stratumConn, stdinReader
+}
+
+// Determine whether the current instant falls within one of the configured excluded
+// mining-schedule windows.
+// @param schedule - The configured excluded windows
+// @param now - The instant to check
+// @returns - True if mining should be paused for a schedule window
+func isWithinExcludedWindow(schedule []ScheduleWindow, now time.Time) bool {
+	for _, window := range schedule {
+		loc, err := time.LoadLocation(window.Timezone)
+		if err != nil {
+			log.Println("Invalid schedule timezone " + window.Timezone + "; skipping window.")
+			continue
+		}
+		local := now.In(loc)
+		dayMatches := false
+		for _, day := range window.Days {
+			if strings.EqualFold(day, local.Weekday().String()[:3]) {
+				dayMatches = true
+				break
+			}
+		}
+		if !dayMatches {
+			continue
+		}
+		start, err := time.ParseInLocation("15:04", window.StartTime, loc)
+		if err != nil {
+			continue
+		}
+		end, err := time.ParseInLocation("15:04", window.EndTime, loc)
+		if err != nil {
+			continue
+		}
+		minuteOfDay := local.Hour()*60 + local.Minute()
+		startMinute := start.Hour()*60 + start.Minute()
+		endMinute := end.Hour()*60 + end.Minute()
+		if startMinute <= endMinute {
+			if minuteOfDay >= startMinute && minuteOfDay < endMinute {
+				return true
+			}
+		} else {
+			// The window wraps past midnight (e.g. startTime="22:00" endTime="06:00" for an
+			// overnight quiet period), so it matches either side of midnight rather than a
+			// single contiguous range.
+			if minuteOfDay >= startMinute || minuteOfDay < endMinute {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Determine whether the system is currently too hot or too loaded to keep mining,
+// per the configured thresholds.
+// @param config - The configuration details from the HCL config file
+// @returns - True and a reason, if either threshold is currently exceeded
+func isOverResourceThreshold(config Config) (bool, string) {
+	if config.MaxLoadAverage > 0 {
+		avg, err := load.Avg()
+		if err == nil && avg.Load1 > config.MaxLoadAverage {
+			return true, fmt.Sprintf("1-minute load average %.2f exceeds configured max %.2f",
+				avg.Load1, config.MaxLoadAverage)
+		}
+	}
+	if config.MaxTemperatureCelsius > 0 {
+		temps, err := host.SensorsTemperatures()
+		if err == nil {
+			for _, temp := range temps {
+				if temp.Temperature > config.MaxTemperatureCelsius {
+					return true, fmt.Sprintf("sensor %s reports %.1f°C, exceeding configured max %.1f°C",
+						temp.SensorKey, temp.Temperature, config.MaxTemperatureCelsius)
+				}
+			}
+		}
+	}
+	return false, ""
+}
+
+// Kill the current mining process and verify it has actually stopped before returning.
+// There were scenarios where the process did not stop immediately, so this retries
+// until it verifiably exits rather than trusting a single Kill/Wait.
+// @param proc - The mining process to stop
+// @param config - The configuration details from the HCL config file, used for failure e-mail notices
+// @param logFn - Called with each retry/failure message, for GET /logs/tail, or nil to skip
+func killMinerProcess(proc *os.Process, config Config, logFn func(string)) {
+	proc.Kill() // Stop the current mining process.
+	proc.Wait() // Wait for everything to stop. Also releases resources.
+	exists, _ := process.PidExists(int32(proc.Pid))
+	timesKilled := 0      // Prevent endless loops
+	maxKillNumber := 1000 // Stop after 1,000 attempts
+	for exists {
+		timesKilled++
+		// If attempted to kill it 1,000 times, exit and notify via e-mail if possible.
+		if timesKilled > maxKillNumber {
+			issue := "Fatal error: Unable to close inferior process after 1,000 attempts."
+			if logFn != nil {
+				logFn(issue)
+			}
+			// Send an e-mail notification if the server is set.
+			if len(config.EmailServer) > 0 {
+				SendEmail(issue,
+					"Please review the miner for details and report this issue.",
+					config.EmailUser, config.EmailPassword,
+					config.EmailServer, config.EmailPort,
+					config.EmailTo, config.EmailFrom)
+			}
+			log.Fatal(issue) // Force exit
+		}
+		msg := "Previous mining process has not stopped. Attempting to kill the process again..."
+		log.Println(msg)
+		if logFn != nil {
+			logFn(msg)
+		}
+		proc.Kill() // Stop the current mining process.
+		proc.Wait() // Wait for everything to stop. Also releases resources.
+		// Give it time to stop.
+		time.Sleep(time.Duration(10) * time.Second)
+		exists, _ = process.PidExists(int32(proc.Pid))
+	}
 }
 
-// Open a process and get back the pointer to it.
+// Open a process and get back the pointer to it. Stdout/stderr are still passed through
+// to the console as before, but are also scanned line-by-line so minerStats can be kept
+// up to date from actually-observed hashrate and share activity instead of relying
+// solely on a separate minerStats.exe pass.
 // @param filePath - The path to the executable to open
 // @param params - The parameters to use for the process
-func openProcess(filePath string, params []string) *os.Process {
-	output := []*os.File{os.Stdin, os.Stdout, os.Stderr}
-	// Open the miner program in a child process.
-	attr := &os.ProcAttr{
-		"",
-		nil,
-		output,
-		&syscall.SysProcAttr{},
-	}
-	proc, error := os.StartProcess(filePath, params, attr)
-	if error != nil {
-		log.Fatalf("Unable to start mining software.\n", error)
-	}
-	return proc
+// @param minerStats - The stats tracker to feed with parsed output lines, or nil to skip parsing
+// @param stratumStdin - The read end of a Stratum job/difficulty feed to use as the
+//    process's stdin instead of the terminal, or nil if UseStratumClient is not set
+// @param stratumConn - The Stratum connection dispatched jobs came from, so completed
+//    shares read back from the process's stdout can be submitted to the pool directly,
+//    or nil if UseStratumClient is not set
+func openProcess(filePath string, params []string, minerStats *stats.Stats, stratumStdin io.Reader,
+	stratumConn *client.Client) *os.Process {
+	// params[0] holds the software name, passed by convention as argv[0]; the rest are
+	// the actual command-line arguments for the mining software.
+	cmd := exec.Command(filePath, params[1:]...)
+	cmd.Args[0] = params[0]
+	if stratumStdin != nil {
+		cmd.Stdin = stratumStdin
+	} else {
+		cmd.Stdin = os.Stdin
+	}
+	stdoutPipe, err := cmd.StdoutPipe()
+	if err != nil {
+		log.Fatalf("Unable to attach to mining software stdout.\n", err)
+	}
+	stderrPipe, err := cmd.StderrPipe()
+	if err != nil {
+		log.Fatalf("Unable to attach to mining software stderr.\n", err)
+	}
+	if err := cmd.Start(); err != nil {
+		log.Fatalf("Unable to start mining software.\n", err)
+	}
+	go teeAndParse(stdoutPipe, os.Stdout, minerStats, stratumConn)
+	go teeAndParse(stderrPipe, os.Stderr, minerStats, stratumConn)
+	return cmd.Process
+}
+
+// teeAndParse copies miner output to the console as before while also handing each line
+// to the stats tracker for parsing. When a Stratum connection is in play, a line
+// reporting a completed share is instead submitted to the pool directly via SubmitShare,
+// with the accept/reject result recorded against minerStats, rather than relying on a
+// text heuristic over the miner's own log output.
+// @param src - The pipe carrying the miner process's stdout or stderr
+// @param dst - Where the output should still be echoed (os.Stdout or os.Stderr)
+// @param minerStats - The stats tracker to feed, or nil to skip parsing
+// @param stratumConn - The Stratum connection to submit completed shares to, or nil if
+//    UseStratumClient is not set
+func teeAndParse(src io.Reader, dst io.Writer, minerStats *stats.Stats, stratumConn *client.Client) {
+	scanner := bufio.NewScanner(src)
+	for scanner.Scan() {
+		line := scanner.Text()
+		fmt.Fprintln(dst, line)
+		if stratumConn != nil {
+			if jobID, extraNonce2, nTime, nonce, ok := client.ParseShareLine(line); ok {
+				accepted, err := stratumConn.SubmitShare(jobID, extraNonce2, nTime, nonce)
+				if minerStats != nil {
+					if err == nil && accepted {
+						minerStats.RecordAccepted()
+					} else {
+						minerStats.RecordRejected()
+					}
+				}
+				continue
+			}
+		}
+		if minerStats != nil {
+			minerStats.ParseLine(line)
+		}
+	}
 }
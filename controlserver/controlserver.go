@@ -0,0 +1,358 @@
+// Package controlserver exposes an HTTP+JSON API for remote management of one or more
+// running miners: current state, manual pause/resume, manual algo override, the ranked
+// candidate list the optimizer is choosing from, and a log tail. All mutable state
+// the optimization loop needs to read is centralized in MinerController, one per miner,
+// so that both the loop and the HTTP handlers act on the same data instead of
+// loop-local variables, and Server multiplexes requests across all of them by name.
+package controlserver
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/GregoryUnderscore/Mining-Automation/stats"
+)
+
+// Candidate is a single ranked software/algo option, as considered by the optimizer.
+type Candidate struct {
+	MinerSoftwareAlgoID uint64  `json:"minerSoftwareAlgoId"`
+	Software            string  `json:"software"`
+	Algo                string  `json:"algo"`
+	Score               float64 `json:"score"`
+	Blacklisted         bool    `json:"blacklisted"`
+}
+
+// State is a point-in-time snapshot of the controller, as returned by GET /state.
+type State struct {
+	Software    string      `json:"software"`
+	Algo        string      `json:"algo"`
+	Hashrate    float64     `json:"recentHashrate"`
+	Uptime      string      `json:"uptime"`
+	LastCheckIn time.Time   `json:"lastCheckIn"`
+	Paused      bool        `json:"paused"`
+	PauseReason string      `json:"pauseReason,omitempty"`
+	ManualAlgo  *uint64     `json:"manualAlgoOverride,omitempty"`
+	MiningState MiningState `json:"miningState"`
+}
+
+// MinerController centralizes the mutable state of the optimization/kill loop so that
+// HTTP handlers can read and mutate it safely from outside the loop's own goroutine.
+type MinerController struct {
+	mu sync.Mutex
+
+	software    string
+	algo        string
+	startTime   time.Time
+	lastCheckIn time.Time
+	stats       *Stats
+
+	forcePaused bool   // Set by POST /pause; cleared by POST /resume
+	pauseReason string // Human-readable reason for the most recent pause, whatever the source
+
+	manualAlgoID *uint64 // Set by POST /switch; nil means "let the optimizer decide"
+
+	candidates []Candidate
+
+	logTail []string // Most recent log lines, capped at logTailCapacity
+}
+
+// logTailCapacity bounds how many recent log lines GET /logs/tail keeps in memory.
+const logTailCapacity = 200
+
+// NewMinerController creates an empty controller ready to be updated as the optimization
+// loop starts its first mining process.
+func NewMinerController() *MinerController {
+	return &MinerController{startTime: time.Now()}
+}
+
+// SetActive records the software/algo combination and stats tracker currently in use.
+// @param software - The name of the active mining software
+// @param algo - The name of the active algorithm
+// @param minerStats - The live stats tracker for this combination
+func (c *MinerController) SetActive(software string, algo string, minerStats *Stats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.software = software
+	c.algo = algo
+	c.stats = minerStats
+}
+
+// SetCheckIn records the instant of the most recent successful check-in.
+func (c *MinerController) SetCheckIn(when time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastCheckIn = when
+}
+
+// SetCandidates replaces the ranked candidate list surfaced by GET /candidates.
+func (c *MinerController) SetCandidates(candidates []Candidate) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.candidates = candidates
+}
+
+// SetAutomaticPause records a pause originating from the schedule/resource logic in the
+// main loop, as opposed to an operator-issued POST /pause.
+// @param reason - A human-readable description, or "" to clear the pause
+func (c *MinerController) SetAutomaticPause(reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pauseReason = reason
+}
+
+// ForcePaused reports whether an operator has asked for mining to be force-paused via
+// POST /pause, overriding the optimizer regardless of schedule/resource state.
+func (c *MinerController) ForcePaused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.forcePaused
+}
+
+// ManualAlgoID returns the operator-selected algo override, if POST /switch was used,
+// or nil if the optimizer should continue choosing automatically.
+func (c *MinerController) ManualAlgoID() *uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.manualAlgoID
+}
+
+// AppendLog records a line for GET /logs/tail, keeping at most logTailCapacity lines.
+func (c *MinerController) AppendLog(line string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.logTail = append(c.logTail, line)
+	if len(c.logTail) > logTailCapacity {
+		c.logTail = c.logTail[len(c.logTail)-logTailCapacity:]
+	}
+}
+
+// snapshot builds the JSON-serializable state returned by GET /state.
+func (c *MinerController) snapshot() State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	state := State{
+		Software:    c.software,
+		Algo:        c.algo,
+		Uptime:      time.Since(c.startTime).String(),
+		LastCheckIn: c.lastCheckIn,
+		Paused:      c.forcePaused || c.pauseReason != "",
+		PauseReason: c.pauseReason,
+		ManualAlgo:  c.manualAlgoID,
+		MiningState: MINING_ACTIVE,
+	}
+	if c.stats != nil {
+		minerState := c.stats.GetMinerState()
+		state.Hashrate = minerState.RecentHashrate
+		state.MiningState = minerState.State
+	}
+	// Normally minerState.State above already reflects the actual reason the loop paused
+	// (user override, schedule, or resource threshold). This only covers the gap before
+	// that reaches the stats tracker, e.g. right at startup before mining has begun.
+	if state.Paused && state.MiningState == MINING_ACTIVE {
+		if c.forcePaused {
+			state.MiningState = MINING_PAUSED_USER_OVERRIDE
+		} else {
+			state.MiningState = MINING_PAUSED_TIME_EXCLUDED
+		}
+	}
+	return state
+}
+
+// Server wraps an http.Server bound to one MinerController per managed miner, so a single
+// control API can operate a whole farm rather than just one rig. Each miner's endpoints are
+// namespaced under /miners/<name>/, e.g. GET /miners/Rig1-GPU0/state.
+type Server struct {
+	httpServer  *http.Server
+	controllers map[string]*MinerController
+	token       string // Required bearer token for the mutating routes, or "" to leave them open
+}
+
+// NewServer creates a control server bound to addr, backed by the given controllers, keyed
+// by miner name. Start must be called to begin serving.
+// @param addr - The address to bind to, e.g. "127.0.0.1:9090"
+// @param controllers - One controller per managed miner, keyed by miner name
+// @param token - Required bearer token for POST /pause, /resume, and /switch, or "" to
+//    leave those routes unprotected (only safe if addr is loopback-only)
+func NewServer(addr string, controllers map[string]*MinerController, token string) *Server {
+	server := &Server{controllers: controllers, token: token}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/miners", server.handleList)
+	mux.HandleFunc("/miners/", server.handleMinerRoute)
+	server.httpServer = &http.Server{Addr: addr, Handler: mux}
+	return server
+}
+
+// authorized reports whether r carries the configured bearer token. If no token was
+// configured, every request is allowed, since the mutating routes are then only safe to
+// expose on a loopback-bound address in the first place.
+func (s *Server) authorized(r *http.Request) bool {
+	if s.token == "" {
+		return true
+	}
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, prefix) {
+		return false
+	}
+	given := strings.TrimPrefix(auth, prefix)
+	return subtle.ConstantTimeCompare([]byte(given), []byte(s.token)) == 1
+}
+
+// Start begins serving the control API in the background. Errors other than a clean
+// shutdown are logged to every controller's log tail rather than crashing the miner.
+func (s *Server) Start() {
+	go func() {
+		if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			for _, controller := range s.controllers {
+				controller.AppendLog("control server error: " + err.Error())
+			}
+		}
+	}()
+}
+
+// Stop gracefully shuts down the control API.
+func (s *Server) Stop() error {
+	return s.httpServer.Close()
+}
+
+// handleList reports the names of every miner this control API manages, so an operator or
+// dashboard can discover the /miners/<name>/... routes without prior knowledge of the config.
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	names := make([]string, 0, len(s.controllers))
+	for name := range s.controllers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	writeJSON(w, names)
+}
+
+// handleMinerRoute dispatches /miners/<name>/<action> to the action handler for that miner's
+// own controller, so every endpoint is available separately for each miner.
+func (s *Server) handleMinerRoute(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/miners/")
+	name, action, found := strings.Cut(path, "/")
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	controller, ok := s.controllers[name]
+	if !ok {
+		http.Error(w, "unknown miner: "+name, http.StatusNotFound)
+		return
+	}
+	// pause/resume/switch mutate miner behavior, so they require the configured bearer
+	// token; state/candidates/logs/tail are read-only and stay open to any caller that
+	// can reach the address.
+	switch action {
+	case "state":
+		handleState(w, r, controller)
+	case "pause":
+		if !s.authorized(r) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handlePause(w, r, controller)
+	case "resume":
+		if !s.authorized(r) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handleResume(w, r, controller)
+	case "switch":
+		if !s.authorized(r) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handleSwitch(w, r, controller)
+	case "candidates":
+		handleCandidates(w, r, controller)
+	case "logs/tail":
+		handleLogsTail(w, r, controller)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func handleState(w http.ResponseWriter, r *http.Request, controller *MinerController) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, controller.snapshot())
+}
+
+func handlePause(w http.ResponseWriter, r *http.Request, controller *MinerController) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	controller.mu.Lock()
+	controller.forcePaused = true
+	controller.mu.Unlock()
+	writeJSON(w, controller.snapshot())
+}
+
+func handleResume(w http.ResponseWriter, r *http.Request, controller *MinerController) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	controller.mu.Lock()
+	controller.forcePaused = false
+	controller.mu.Unlock()
+	writeJSON(w, controller.snapshot())
+}
+
+func handleSwitch(w http.ResponseWriter, r *http.Request, controller *MinerController) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var body struct {
+		AlgoID *uint64 `json:"algo_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	controller.mu.Lock()
+	controller.manualAlgoID = body.AlgoID
+	controller.mu.Unlock()
+	writeJSON(w, controller.snapshot())
+}
+
+func handleCandidates(w http.ResponseWriter, r *http.Request, controller *MinerController) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	controller.mu.Lock()
+	candidates := controller.candidates
+	controller.mu.Unlock()
+	writeJSON(w, candidates)
+}
+
+func handleLogsTail(w http.ResponseWriter, r *http.Request, controller *MinerController) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	controller.mu.Lock()
+	lines := append([]string(nil), controller.logTail...)
+	controller.mu.Unlock()
+	writeJSON(w, lines)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
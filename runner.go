@@ -0,0 +1,393 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/process"
+	"gorm.io/gorm"
+
+	. "github.com/GregoryUnderscore/Mining-Automation-Shared/database"
+	. "github.com/GregoryUnderscore/Mining-Automation-Shared/models"
+	. "github.com/GregoryUnderscore/Mining-Automation-Shared/utils/email"
+
+	"github.com/GregoryUnderscore/Mining-Automation/controlserver"
+	"github.com/GregoryUnderscore/Mining-Automation/stats"
+	"github.com/GregoryUnderscore/Mining-Automation/stratum/client"
+)
+
+// noticeFlushInterval is how often the supervisor folds up any queued algo-change
+// notices into a single combined e-mail, rather than sending one per miner.
+const noticeFlushInterval = time.Minute
+
+// processCheckTime is how long a runner sleeps between checks of its own mining
+// process, the same cadence the single-miner loop used.
+const processCheckTime = 30 // seconds
+
+// MinerRunner holds everything that used to be a local variable in main()'s loop for a
+// single miner: its database-backed identity, its currently active software/algo and
+// running process, and the control API state the operator can read and mutate.
+type MinerRunner struct {
+	shared    Config      // Settings common to every miner (database, schedule, EMA tuning, e-mail)
+	minerConf MinerConfig // Settings specific to this miner (name, wallet, pool password)
+
+	db        *gorm.DB
+	minerID   uint64
+	thisMiner Miner
+
+	controller *controlserver.MinerController
+
+	bestSoftwareAlgo MinerSoftwareAlgos
+	params           []string
+	filePath         string
+	proc             *os.Process
+	stratumConn      *client.Client
+	minerStats       *stats.Stats
+	launchedAt       time.Time // When proc was started, for failure-grace-period detection
+}
+
+// Supervisor owns every MinerRunner on this host, plus the state that must be
+// coordinated across all of them rather than kept per-runner: a lock that serializes
+// algo switches so two runners don't thrash the same box's GPU(s) at once, a batch of
+// pending e-mail notices so the operator gets one combined summary instead of one per
+// miner, and the most recent check-in instant seen from each runner.
+type Supervisor struct {
+	db     *gorm.DB
+	shared Config
+
+	runners []*MinerRunner
+
+	// switchMu is held for the duration of any kill/relaunch of a mining process, across
+	// every runner, so concurrent algo switches on different miners don't hit the GPU(s)
+	// at the same moment.
+	switchMu sync.Mutex
+
+	emailMu        sync.Mutex
+	pendingNotices []string
+
+	checkInMu    sync.Mutex
+	lastCheckIns map[string]time.Time
+}
+
+// NewSupervisor creates a supervisor with no runners yet; call AddRunner once per
+// configured miner before Run.
+// @param db - The shared database connection every runner will use
+// @param shared - The configuration settings common to every miner
+func NewSupervisor(db *gorm.DB, shared Config) *Supervisor {
+	return &Supervisor{db: db, shared: shared, lastCheckIns: make(map[string]time.Time)}
+}
+
+// AddRunner verifies the miner record for minerConf exists (creating it if necessary,
+// the same as the single-miner startup used to) and registers a MinerRunner for it.
+// @param minerConf - The settings for the miner to add
+func (sup *Supervisor) AddRunner(minerConf MinerConfig) {
+	tx := sup.db.Begin()
+	defer func() { // Ensure transaction rollback on panic
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	log.Println("Creating records required for operations: " + minerConf.MinerName)
+	minerID := VerifyMiner(tx, minerConf.MinerName)
+	var thisMiner Miner
+	tx.Where("id = ?", minerID).Find(&thisMiner)
+	if (Miner{}) == thisMiner {
+		log.Fatalf("Unable to locate this miner in the database: " + minerConf.MinerName)
+	}
+	if err := tx.Commit().Error; err != nil {
+		log.Fatalf("Issue committing changes.\n", err)
+	}
+
+	sup.runners = append(sup.runners, &MinerRunner{
+		shared:     sup.shared,
+		minerConf:  minerConf,
+		db:         sup.db,
+		minerID:    minerID,
+		thisMiner:  thisMiner,
+		controller: controlserver.NewMinerController(),
+	})
+}
+
+// Controllers returns every runner's controller, keyed by miner name, for binding to
+// the control API server.
+func (sup *Supervisor) Controllers() map[string]*controlserver.MinerController {
+	controllers := make(map[string]*controlserver.MinerController, len(sup.runners))
+	for _, runner := range sup.runners {
+		controllers[runner.minerConf.MinerName] = runner.controller
+	}
+	return controllers
+}
+
+// Run starts one goroutine per runner and the notice-flushing goroutine, and blocks
+// until every runner's loop exits, which in normal operation never happens.
+func (sup *Supervisor) Run() {
+	var wg sync.WaitGroup
+	for _, runner := range sup.runners {
+		wg.Add(1)
+		go func(r *MinerRunner) {
+			defer wg.Done()
+			r.run(sup)
+		}(runner)
+	}
+	go sup.flushNoticesLoop()
+	wg.Wait()
+}
+
+// queueNotice records a notice (an algo change or a stale check-in warning) to be folded
+// into the next batched e-mail, instead of sending one e-mail per miner per event.
+func (sup *Supervisor) queueNotice(subject string, body string) {
+	sup.emailMu.Lock()
+	defer sup.emailMu.Unlock()
+	sup.pendingNotices = append(sup.pendingNotices, subject+"\r\n"+body)
+}
+
+// flushNoticesLoop periodically hands any queued notices off to flushNotices and checks
+// every runner's last check-in for staleness.
+func (sup *Supervisor) flushNoticesLoop() {
+	for {
+		time.Sleep(noticeFlushInterval)
+		sup.flushNotices()
+		sup.checkStaleRunners()
+	}
+}
+
+// staleCheckInThreshold is how long a runner can go without a recorded check-in before
+// the supervisor treats it as stalled and surfaces a warning, rather than lastCheckIns
+// just being write-only state nothing ever reads.
+const staleCheckInThreshold = 10 * time.Minute
+
+// checkStaleRunners warns, via the log and the batched e-mail, about any runner whose
+// last recorded check-in is older than staleCheckInThreshold, so an operator finds out
+// about a stuck runner instead of having to notice its absence from a dashboard.
+func (sup *Supervisor) checkStaleRunners() {
+	sup.checkInMu.Lock()
+	now := time.Now()
+	var stale []string
+	for name, when := range sup.lastCheckIns {
+		if now.Sub(when) > staleCheckInThreshold {
+			stale = append(stale, name)
+		}
+	}
+	sup.checkInMu.Unlock()
+	for _, name := range stale {
+		msg := fmt.Sprintf("%s has not checked in for over %s", name, staleCheckInThreshold)
+		log.Println(msg)
+		sup.queueNotice("Mining-Automation: stale miner check-in", msg)
+	}
+}
+
+// flushNotices sends every notice queued since the last flush as a single e-mail, so an
+// operator running a dozen miners gets one summary rather than a dozen separate e-mails.
+func (sup *Supervisor) flushNotices() {
+	sup.emailMu.Lock()
+	notices := sup.pendingNotices
+	sup.pendingNotices = nil
+	sup.emailMu.Unlock()
+	if len(notices) == 0 || len(sup.shared.EmailServer) == 0 {
+		return
+	}
+	body := strings.Join(notices, "\r\n----\r\n")
+	SendEmail(fmt.Sprintf("Mining-Automation: %d notice(s)", len(notices)), body,
+		sup.shared.EmailUser, sup.shared.EmailPassword, sup.shared.EmailServer, sup.shared.EmailPort,
+		sup.shared.EmailTo, sup.shared.EmailFrom)
+}
+
+// recordCheckIn aggregates the most recent check-in instant seen from any runner, so the
+// supervisor has a single picture of farm-wide liveness rather than each runner only
+// knowing about itself.
+func (sup *Supervisor) recordCheckIn(minerName string, when time.Time) {
+	sup.checkInMu.Lock()
+	defer sup.checkInMu.Unlock()
+	sup.lastCheckIns[minerName] = when
+}
+
+// logf writes a line to the standard log and to this runner's own controller, prefixed
+// with the miner name, so GET /logs/tail reflects the same operational events (pause,
+// resume, algo switches, kill-process retries) an operator watching the console sees.
+func (r *MinerRunner) logf(line string) {
+	full := "[" + r.minerConf.MinerName + "] " + line
+	log.Println(full)
+	r.controller.AppendLog(full)
+}
+
+// run is the per-miner optimization/kill loop, equivalent to the body of the old
+// single-miner main() loop, but operating on this runner's own state and coordinating
+// with the rest of the farm through the supervisor.
+func (r *MinerRunner) run(sup *Supervisor) {
+	defer func() { // Ensure process/connection are eliminated on panic/exit
+		if r.proc != nil {
+			r.proc.Kill()
+		}
+		if r.stratumConn != nil {
+			r.stratumConn.Close()
+		}
+	}()
+
+	r.logf("Determining optimal software/algo combination...")
+	sup.switchMu.Lock()
+	r.bestSoftwareAlgo = getBestSoftwareAlgo(r.db, r.minerID, r.shared, r.minerConf)
+	r.params, r.filePath = changeAlgoGetParams(r.db, &r.thisMiner, r.bestSoftwareAlgo, r.shared,
+		r.minerConf, sup.queueNotice, r.controller.AppendLog)
+	r.minerStats = stats.New(r.params[0], r.bestSoftwareAlgo.Name)
+	r.controller.SetActive(r.params[0], r.bestSoftwareAlgo.Name, r.minerStats)
+	var stdin io.Reader
+	if r.minerConf.UseStratumClient == 1 {
+		r.stratumConn, stdin = openStratumClient(r.db, r.bestSoftwareAlgo.AlgorithmID, r.minerConf,
+			r.minerStats, r.controller.AppendLog)
+	}
+	r.proc = openProcess(r.filePath, r.params, r.minerStats, stdin, r.stratumConn)
+	r.launchedAt = time.Now()
+	sup.switchMu.Unlock()
+
+	secondsSlept := 0 // Tracks the total time slept to know when to check for optimization
+	paused := false   // Whether mining is currently paused for a schedule/resource reason
+	for {
+		// Check whether we should be paused for an excluded schedule window or an
+		// over-temperature/over-load condition before doing anything else.
+		excluded := isWithinExcludedWindow(r.shared.MiningSchedule, time.Now())
+		overThreshold, reason := isOverResourceThreshold(r.shared)
+		forcePaused := r.controller.ForcePaused() // Operator-issued POST /pause overrides everything else.
+		if excluded || overThreshold || forcePaused {
+			if !paused {
+				// Identify which condition actually fired so the reported mining state
+				// reflects the real reason instead of always reading as one hardcoded value.
+				var pauseState stats.MiningState
+				switch {
+				case forcePaused:
+					reason = "paused via control API"
+					pauseState = stats.MINING_PAUSED_USER_OVERRIDE
+				case excluded:
+					reason = "current time falls within an excluded schedule window"
+					pauseState = stats.MINING_PAUSED_TIME_EXCLUDED
+				default:
+					// overThreshold; reason is already set by isOverResourceThreshold.
+					pauseState = stats.MINING_PAUSED_RESOURCE_THRESHOLD
+				}
+				r.logf("Pausing mining: " + reason)
+				sup.switchMu.Lock()
+				killMinerProcess(r.proc, r.shared, r.controller.AppendLog)
+				if r.stratumConn != nil {
+					r.stratumConn.Close()
+					r.stratumConn = nil
+				}
+				sup.switchMu.Unlock()
+				r.minerStats.SetState(pauseState)
+				r.controller.SetAutomaticPause(reason)
+				paused = true
+			}
+			time.Sleep(time.Duration(processCheckTime) * time.Second)
+			continue
+		}
+		if paused {
+			// The excluded window/threshold has lifted; resume mining with the current
+			// best software/algo, the same as a fresh start.
+			r.logf("Resuming mining after pause.")
+			sup.switchMu.Lock()
+			r.bestSoftwareAlgo = resolveBestAlgo(r.db, r.minerID, r.shared, r.minerConf, r.controller)
+			r.params, r.filePath = changeAlgoGetParams(r.db, &r.thisMiner, r.bestSoftwareAlgo, r.shared,
+				r.minerConf, sup.queueNotice, r.controller.AppendLog)
+			r.minerStats = stats.New(r.params[0], r.bestSoftwareAlgo.Name)
+			r.controller.SetActive(r.params[0], r.bestSoftwareAlgo.Name, r.minerStats)
+			r.controller.SetAutomaticPause("")
+			var stdin io.Reader
+			if r.minerConf.UseStratumClient == 1 {
+				r.stratumConn, stdin = openStratumClient(r.db, r.bestSoftwareAlgo.AlgorithmID, r.minerConf,
+					r.minerStats, r.controller.AppendLog)
+			}
+			r.proc = openProcess(r.filePath, r.params, r.minerStats, stdin, r.stratumConn)
+			r.launchedAt = time.Now()
+			sup.switchMu.Unlock()
+			paused = false
+			secondsSlept = 0
+			continue
+		}
+
+		// Time to check for an optimization.
+		if secondsSlept > 0 && (secondsSlept%r.shared.OptimizationCheckTime == 0) {
+			secondsSlept = 0 // Reset
+			// Rank candidates once and reuse the result for both the surfaced candidate
+			// list and the optimizer's pick, rather than letting each recompute the EMA
+			// update and failure-penalty lookup independently.
+			ranked := getCandidateSoftwareAlgos(r.db, r.minerID, r.shared, r.minerConf)
+			r.controller.SetCandidates(toCandidates(ranked))
+			optimizationAlgo := resolveBestAlgoFromRanked(r.db, ranked, r.controller)
+			// Is the best algo a change?
+			if optimizationAlgo.ID != r.thisMiner.MinerSoftwareAlgoID {
+				// Serialized against every other runner so two miners on the same box
+				// don't both kill/relaunch and thrash the GPU(s) at the same moment.
+				sup.switchMu.Lock()
+				killMinerProcess(r.proc, r.shared, r.controller.AppendLog)
+				r.params, r.filePath = changeAlgoGetParams(r.db, &r.thisMiner, optimizationAlgo,
+					r.shared, r.minerConf, sup.queueNotice, r.controller.AppendLog)
+				r.bestSoftwareAlgo = optimizationAlgo // Track as the current combo for failure detection.
+				// The old combination's counters do not apply to the new one.
+				r.minerStats = stats.New(r.params[0], optimizationAlgo.Name)
+				r.controller.SetActive(r.params[0], optimizationAlgo.Name, r.minerStats)
+				// Tear down the Stratum connection and open a new one to the new
+				// algorithm's pool.
+				var stdin io.Reader
+				if r.minerConf.UseStratumClient == 1 {
+					if r.stratumConn != nil {
+						r.stratumConn.Close()
+					}
+					r.stratumConn, stdin = openStratumClient(r.db, optimizationAlgo.AlgorithmID, r.minerConf,
+						r.minerStats, r.controller.AppendLog)
+				}
+				r.proc = openProcess(r.filePath, r.params, r.minerStats, stdin, r.stratumConn)
+				r.launchedAt = time.Now()
+				sup.switchMu.Unlock()
+			}
+			// Record how fresh the pool-side data behind the now-active combo's score is,
+			// so GetMinerState().PoolStatSecondsOld reflects real staleness instead of
+			// reading as zero forever.
+			if at, ok := poolStatAtFor(ranked, optimizationAlgo.ID); ok {
+				r.minerStats.RecordPoolStat(at)
+			}
+		} else {
+			// Wait and then validate the process still exists.
+			time.Sleep(time.Duration(processCheckTime) * time.Second)
+			secondsSlept += processCheckTime
+			exists, _ := process.PidExists(int32(r.proc.Pid))
+			if exists {
+				// Store a check-in instant to indicate this is still active.
+				checkIn(r.db, &r.thisMiner, r.minerStats)
+				r.controller.SetCheckIn(r.thisMiner.LastCheckIn)
+				sup.recordCheckIn(r.minerConf.MinerName, r.thisMiner.LastCheckIn)
+				continue
+			}
+
+			// Process exited probably on error. If it died shortly after launch, this
+			// combination gets a failure strike so the optimizer stops reshuffling onto it.
+			recordLaunchOutcome(r.db, r.minerID, r.bestSoftwareAlgo.MinerSoftwareID,
+				r.bestSoftwareAlgo.AlgorithmID, r.launchedAt, r.shared)
+			sup.switchMu.Lock()
+			killMinerProcess(r.proc, r.shared, r.controller.AppendLog) // Ensure everything has been cleared.
+			// Re-resolve rather than blindly relaunching the same combination: the failure
+			// strike just recorded above may have pushed it into cooldown, and without this
+			// a combo that reliably crashes on launch would otherwise just be relaunched
+			// every processCheckTime forever.
+			r.bestSoftwareAlgo = resolveBestAlgo(r.db, r.minerID, r.shared, r.minerConf, r.controller)
+			r.params, r.filePath = changeAlgoGetParams(r.db, &r.thisMiner, r.bestSoftwareAlgo, r.shared,
+				r.minerConf, sup.queueNotice, r.controller.AppendLog)
+			r.minerStats = stats.New(r.params[0], r.bestSoftwareAlgo.Name)
+			r.controller.SetActive(r.params[0], r.bestSoftwareAlgo.Name, r.minerStats)
+			var stdin io.Reader
+			if r.minerConf.UseStratumClient == 1 {
+				if r.stratumConn != nil {
+					r.stratumConn.Close()
+				}
+				r.stratumConn, stdin = openStratumClient(r.db, r.bestSoftwareAlgo.AlgorithmID, r.minerConf,
+					r.minerStats, r.controller.AppendLog)
+			}
+			r.proc = openProcess(r.filePath, r.params, r.minerStats, stdin, r.stratumConn)
+			r.launchedAt = time.Now()
+			sup.switchMu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,240 @@
+// Package stats tracks in-process hashrate and share statistics for a running miner
+// process, so that miner_stats rows can be written from actually-observed behavior
+// instead of depending entirely on a separately-run minerStats.exe pass.
+package stats
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MiningState describes why a miner is or is not currently hashing.
+type MiningState int
+
+const (
+	// MINING_ACTIVE indicates the miner is actively hashing.
+	MINING_ACTIVE MiningState = iota
+	// MINING_PAUSED_USER_OVERRIDE indicates an operator manually paused mining.
+	MINING_PAUSED_USER_OVERRIDE
+	// MINING_PAUSED_TIME_EXCLUDED indicates mining is paused for a configured schedule window.
+	MINING_PAUSED_TIME_EXCLUDED
+	// MINING_PAUSED_NO_CONNECTIVITY indicates the pool connection is currently down.
+	MINING_PAUSED_NO_CONNECTIVITY
+	// MINING_PAUSED_RESOURCE_THRESHOLD indicates mining is paused for an over-temperature
+	// or over-load condition.
+	MINING_PAUSED_RESOURCE_THRESHOLD
+)
+
+// recentWindow is how far back "recent" hashrate looks when averaging recentHashes samples.
+const recentWindow = 5 * time.Minute
+
+// Stats tracks share and hashrate counters for a single (software, algorithm) combination.
+// All counters are updated atomically from the goroutine reading the miner process's
+// stdout/stderr, and read from the main loop via GetMinerState.
+type Stats struct {
+	Software string
+	Algo     string
+
+	sharesAccepted     uint64 // Atomic count of pool-accepted shares
+	sharesRejected     uint64 // Atomic count of pool-rejected shares
+	clientSideHashes   uint64 // Atomic running total of hashes reported by the miner software
+	startTime          time.Time
+	lastStatsResetTime time.Time
+
+	mu              sync.Mutex
+	recentHashes    []hashSample // Sliding window of recent hashrate samples
+	poolStatAge     time.Time    // When the last pool-side stat was observed
+	state           MiningState
+}
+
+// hashSample is a single client-reported hashrate observation, used to compute the
+// "recent" hashrate over a sliding window distinct from the lifetime average.
+type hashSample struct {
+	when     time.Time
+	hashrate float64
+}
+
+// New creates a Stats tracker for the given software/algo combination, with counters
+// zeroed and the clock started.
+// @param software - The name of the mining software being tracked
+// @param algo - The name of the algorithm being tracked
+// @returns - A ready-to-use Stats tracker
+func New(software string, algo string) *Stats {
+	now := time.Now()
+	return &Stats{
+		Software:           software,
+		Algo:               algo,
+		startTime:          now,
+		lastStatsResetTime: now,
+		state:              MINING_ACTIVE,
+	}
+}
+
+// Reset zeroes the counters and restarts the clock, for use after an algo switch so that
+// stale figures from the previous algorithm do not bleed into the new combination.
+func (s *Stats) Reset() {
+	atomic.StoreUint64(&s.sharesAccepted, 0)
+	atomic.StoreUint64(&s.sharesRejected, 0)
+	atomic.StoreUint64(&s.clientSideHashes, 0)
+	s.mu.Lock()
+	s.recentHashes = nil
+	s.lastStatsResetTime = time.Now()
+	s.mu.Unlock()
+}
+
+// SetState records the current reason mining is active or paused.
+func (s *Stats) SetState(state MiningState) {
+	s.mu.Lock()
+	s.state = state
+	s.mu.Unlock()
+}
+
+// RecordAccepted increments the accepted share counter.
+func (s *Stats) RecordAccepted() {
+	atomic.AddUint64(&s.sharesAccepted, 1)
+}
+
+// RecordRejected increments the rejected share counter.
+func (s *Stats) RecordRejected() {
+	atomic.AddUint64(&s.sharesRejected, 1)
+}
+
+// RecordPoolStat marks the instant the most recent pool-side stat was observed, so
+// GetMinerState can report how stale that figure is.
+func (s *Stats) RecordPoolStat(when time.Time) {
+	s.mu.Lock()
+	s.poolStatAge = when
+	s.mu.Unlock()
+}
+
+// RecordHashrate records a hashrate sample as reported by the mining software and folds
+// it into both the lifetime and recent-window averages.
+// @param hashrate - The instantaneous hashrate reported by the mining software
+func (s *Stats) RecordHashrate(hashrate float64) {
+	now := time.Now()
+	s.mu.Lock()
+	// Credit the hashes done at this rate since the previous sample (or the last reset).
+	prev := s.lastStatsResetTime
+	if n := len(s.recentHashes); n > 0 {
+		prev = s.recentHashes[n-1].when
+	}
+	atomic.AddUint64(&s.clientSideHashes, uint64(hashrate*now.Sub(prev).Seconds()))
+	s.recentHashes = append(s.recentHashes, hashSample{when: now, hashrate: hashrate})
+	// Drop samples that have fallen outside the recent window.
+	cutoff := now.Add(-recentWindow)
+	trimmed := s.recentHashes[:0]
+	for _, sample := range s.recentHashes {
+		if sample.when.After(cutoff) {
+			trimmed = append(trimmed, sample)
+		}
+	}
+	s.recentHashes = trimmed
+	s.mu.Unlock()
+}
+
+// ParseLine inspects a single line of miner stdout/stderr for an accepted/rejected share
+// notice or a reported hashrate, and updates the relevant counters. Unrecognized lines
+// are ignored. This is intentionally tolerant since every miner formats its log output
+// differently.
+// @param line - One line of output from the mining process
+func (s *Stats) ParseLine(line string) {
+	lower := strings.ToLower(line)
+	switch {
+	case strings.Contains(lower, "accepted"):
+		s.RecordAccepted()
+	case strings.Contains(lower, "rejected"):
+		s.RecordRejected()
+	}
+	if hashrate, ok := extractHashrate(lower); ok {
+		s.RecordHashrate(hashrate)
+	}
+}
+
+// extractHashrate pulls a "N.NN kh/s"-style figure out of a miner log line, normalized
+// to hashes/second.
+func extractHashrate(lower string) (float64, bool) {
+	units := map[string]float64{
+		"h/s": 1, "kh/s": 1e3, "mh/s": 1e6, "gh/s": 1e9, "th/s": 1e12,
+	}
+	for unit, multiplier := range units {
+		idx := strings.Index(lower, unit)
+		if idx <= 0 {
+			continue
+		}
+		end := idx
+		for end > 0 && lower[end-1] == ' ' {
+			end--
+		}
+		start := end
+		for start > 0 && (isDigitOrDot(lower[start-1])) {
+			start--
+		}
+		if start == end {
+			continue
+		}
+		value, err := strconv.ParseFloat(lower[start:end], 64)
+		if err != nil {
+			continue
+		}
+		return value * multiplier, true
+	}
+	return 0, false
+}
+
+func isDigitOrDot(b byte) bool {
+	return (b >= '0' && b <= '9') || b == '.'
+}
+
+// MinerState is a point-in-time snapshot suitable for writing a miner_stats row or
+// serving a telemetry request.
+type MinerState struct {
+	Software          string
+	Algo              string
+	LifetimeHashrate  float64
+	RecentHashrate    float64
+	SharesAccepted    uint64
+	SharesRejected    uint64
+	PoolStatSecondsOld float64
+	State             MiningState
+}
+
+// GetMinerState returns a snapshot of the current lifetime vs. recent hashrate, the
+// staleness of the last observed pool-side stat, and the current mining state.
+func (s *Stats) GetMinerState() MinerState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lifetimeSeconds := time.Since(s.lastStatsResetTime).Seconds()
+	var lifetimeHashrate float64
+	if lifetimeSeconds > 0 {
+		lifetimeHashrate = float64(atomic.LoadUint64(&s.clientSideHashes)) / lifetimeSeconds
+	}
+
+	var recentHashrate float64
+	if len(s.recentHashes) > 0 {
+		var sum float64
+		for _, sample := range s.recentHashes {
+			sum += sample.hashrate
+		}
+		recentHashrate = sum / float64(len(s.recentHashes))
+	}
+
+	var poolStatSecondsOld float64
+	if !s.poolStatAge.IsZero() {
+		poolStatSecondsOld = time.Since(s.poolStatAge).Seconds()
+	}
+
+	return MinerState{
+		Software:           s.Software,
+		Algo:               s.Algo,
+		LifetimeHashrate:   lifetimeHashrate,
+		RecentHashrate:     recentHashrate,
+		SharesAccepted:     atomic.LoadUint64(&s.sharesAccepted),
+		SharesRejected:     atomic.LoadUint64(&s.sharesRejected),
+		PoolStatSecondsOld: poolStatSecondsOld,
+		State:              s.state,
+	}
+}
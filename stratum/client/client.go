@@ -0,0 +1,360 @@
+// Package client implements a minimal Stratum v1 client for direct pool connectivity.
+// It is an alternative to spawning an external miner executable and handing it pool
+// parameters on the command line: the client owns the TCP/TLS connection to the pool,
+// performs the mining.subscribe/mining.authorize handshake, and dispatches
+// mining.notify/mining.set_difficulty traffic to a consumer of the caller's choosing.
+package client
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Job represents a single mining.notify job as sent by the pool.
+type Job struct {
+	JobID          string
+	PrevHash       string
+	CoinBase1      string
+	CoinBase2      string
+	MerkleBranches []string
+	Version        string
+	NBits          string
+	NTime          string
+	CleanJobs      bool
+}
+
+// JobLine formats a Job as a single tab-separated line for dispatch to a child miner
+// process's stdin, for miners built to read jobs from stdin instead of connecting to a
+// pool themselves.
+// @returns - The job, formatted as one newline-terminated line
+func (j Job) JobLine() string {
+	branches := strings.Join(j.MerkleBranches, ",")
+	return fmt.Sprintf("JOB\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%t\n",
+		j.JobID, j.PrevHash, j.CoinBase1, j.CoinBase2, branches, j.Version, j.NBits, j.NTime, j.CleanJobs)
+}
+
+// DifficultyLine formats a share-difficulty update for dispatch to a child miner
+// process's stdin, using the same tab-separated wire format as JobLine.
+// @param difficulty - The difficulty the pool just set
+// @returns - The update, formatted as one newline-terminated line
+func DifficultyLine(difficulty float64) string {
+	return fmt.Sprintf("DIFF\t%v\n", difficulty)
+}
+
+// ParseShareLine parses a "SHARE\t<jobID>\t<extraNonce2>\t<nTime>\t<nonce>" line as
+// emitted by a child miner process that was dispatched jobs via stdin, for submission
+// back to the pool via SubmitShare.
+// @param line - One line of the child miner process's stdout
+// @returns - The parsed fields, and whether the line matched the share wire format
+func ParseShareLine(line string) (jobID string, extraNonce2 string, nTime string, nonce string, ok bool) {
+	fields := strings.Split(strings.TrimSpace(line), "\t")
+	if len(fields) != 5 || fields[0] != "SHARE" {
+		return "", "", "", "", false
+	}
+	return fields[1], fields[2], fields[3], fields[4], true
+}
+
+// Client holds the state for a single connection to a Stratum v1 pool.
+type Client struct {
+	PoolURL      string // host:port of the pool, as returned by GeneratePoolURL
+	Wallet       string // The wallet used for mining.authorize
+	PoolPassword string // The password field for mining.authorize
+	UseTLS       bool   // If true, wrap the TCP connection in TLS
+
+	conn   net.Conn
+	reader *bufio.Reader
+	nextID uint64 // Incrementing JSON-RPC request ID
+
+	// writeMu serializes writes to conn, since SubmitShare may be invoked concurrently
+	// from the stdout- and stderr-tailing goroutines in teeAndParse.
+	writeMu sync.Mutex
+
+	mu         sync.Mutex
+	difficulty float64
+
+	// pendingMu guards pending. readLoop is the sole reader of conn; it dispatches a
+	// response carrying an ID to the pending call() waiting on it, and everything else
+	// (a notification, with no ID) to OnNotify/OnSetDifficulty.
+	pendingMu sync.Mutex
+	pending   map[uint64]chan rpcResponse
+
+	// OnNotify, if set, is invoked for every mining.notify job received from the pool.
+	OnNotify func(Job)
+	// OnSetDifficulty, if set, is invoked whenever the pool adjusts the share difficulty.
+	OnSetDifficulty func(float64)
+	// OnDisconnect, if set, is invoked when the connection to the pool is lost
+	// unexpectedly, i.e. not as a result of the caller itself calling Close.
+	OnDisconnect func(error)
+
+	sharesAccepted uint64 // Atomically updated count of accepted shares
+	sharesRejected uint64 // Atomically updated count of rejected shares
+
+	closed chan struct{}
+}
+
+// NewClient creates a Client for the given pool URL, wallet, and pool password.
+// @param poolURL - The host:port of the pool, as returned by GeneratePoolURL
+// @param wallet - The wallet to authorize with
+// @param poolPassword - The password field to send with mining.authorize
+// @param useTLS - If true, the connection is established over TLS
+// @returns - A Client ready to Connect
+func NewClient(poolURL string, wallet string, poolPassword string, useTLS bool) *Client {
+	return &Client{
+		PoolURL:      poolURL,
+		Wallet:       wallet,
+		PoolPassword: poolPassword,
+		UseTLS:       useTLS,
+		pending:      make(map[uint64]chan rpcResponse),
+		closed:       make(chan struct{}),
+	}
+}
+
+// rpcRequest is the shape of a Stratum v1 JSON-RPC request.
+type rpcRequest struct {
+	ID     uint64        `json:"id"`
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+}
+
+// rpcResponse is the shape of a Stratum v1 JSON-RPC response or notification.
+type rpcResponse struct {
+	ID     *uint64         `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  json.RawMessage `json:"error"`
+}
+
+// Connect dials the pool, starts the single background goroutine that owns every read
+// from the connection, and performs mining.subscribe followed by mining.authorize.
+// readLoop is started before either call so that, same as every later SubmitShare, the
+// handshake's own responses are dispatched back to it rather than read inline.
+// @returns - An error if the TCP/TLS dial, subscribe, or authorize fails
+func (c *Client) Connect() error {
+	var conn net.Conn
+	var err error
+	if c.UseTLS {
+		conn, err = tls.Dial("tcp", c.PoolURL, &tls.Config{})
+	} else {
+		conn, err = net.Dial("tcp", c.PoolURL)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to connect to pool %s: %w", c.PoolURL, err)
+	}
+	c.conn = conn
+	c.reader = bufio.NewReader(conn)
+	go c.readLoop()
+
+	if _, err := c.call("mining.subscribe", []interface{}{"Mining-Automation"}); err != nil {
+		conn.Close()
+		return fmt.Errorf("mining.subscribe failed: %w", err)
+	}
+	if _, err := c.call("mining.authorize", []interface{}{c.Wallet, c.PoolPassword}); err != nil {
+		conn.Close()
+		return fmt.Errorf("mining.authorize failed: %w", err)
+	}
+
+	return nil
+}
+
+// Close tears down the connection to the pool. It is safe to call Close more than once.
+func (c *Client) Close() error {
+	select {
+	case <-c.closed:
+		return nil
+	default:
+		close(c.closed)
+	}
+	if c.conn != nil {
+		return c.conn.Close()
+	}
+	return nil
+}
+
+// SharesAccepted returns the number of shares the pool has accepted on this connection.
+func (c *Client) SharesAccepted() uint64 {
+	return atomic.LoadUint64(&c.sharesAccepted)
+}
+
+// SharesRejected returns the number of shares the pool has rejected on this connection.
+func (c *Client) SharesRejected() uint64 {
+	return atomic.LoadUint64(&c.sharesRejected)
+}
+
+// SubmitShare submits a completed share back to the pool via mining.submit.
+// @param jobID - The job ID the share was computed against
+// @param extraNonce2 - The miner-assigned extra nonce
+// @param nTime - The nTime used for the share
+// @param nonce - The nonce that satisfied the target
+// @returns - Whether the pool accepted the share, and any error submitting it
+func (c *Client) SubmitShare(jobID string, extraNonce2 string, nTime string, nonce string) (bool, error) {
+	result, err := c.call("mining.submit",
+		[]interface{}{c.Wallet, jobID, extraNonce2, nTime, nonce})
+	if err != nil {
+		atomic.AddUint64(&c.sharesRejected, 1)
+		return false, err
+	}
+	accepted, _ := result.(bool)
+	if accepted {
+		atomic.AddUint64(&c.sharesAccepted, 1)
+	} else {
+		atomic.AddUint64(&c.sharesRejected, 1)
+	}
+	return accepted, nil
+}
+
+// call sends a JSON-RPC request and blocks until readLoop delivers the matching
+// response (or the connection closes). Stratum is a single connection with interleaved
+// requests/notifications and SubmitShare can be called concurrently from more than one
+// goroutine, so readLoop alone reads from c.reader and call only ever registers itself
+// to be woken up by it; this also serializes writes via writeMu, since a concurrent
+// net.Conn.Write from two callers could otherwise interleave on the wire.
+func (c *Client) call(method string, params []interface{}) (interface{}, error) {
+	c.mu.Lock()
+	id := c.nextID
+	c.nextID++
+	c.mu.Unlock()
+
+	respCh := make(chan rpcResponse, 1)
+	c.pendingMu.Lock()
+	c.pending[id] = respCh
+	c.pendingMu.Unlock()
+	defer func() {
+		c.pendingMu.Lock()
+		delete(c.pending, id)
+		c.pendingMu.Unlock()
+	}()
+
+	req := rpcRequest{ID: id, Method: method, Params: params}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	data = append(data, '\n')
+
+	c.writeMu.Lock()
+	_, err = c.conn.Write(data)
+	c.writeMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case resp, ok := <-respCh:
+		if !ok {
+			return nil, fmt.Errorf("stratum connection closed before a response arrived")
+		}
+		if len(resp.Error) > 0 && string(resp.Error) != "null" {
+			return nil, fmt.Errorf("pool returned error: %s", resp.Error)
+		}
+		var result interface{}
+		json.Unmarshal(resp.Result, &result)
+		return result, nil
+	case <-c.closed:
+		return nil, fmt.Errorf("stratum connection closed")
+	}
+}
+
+// readLoop is the sole reader of c.reader for the lifetime of the connection. Every
+// response carrying an ID is routed to the call() that is waiting on it; everything
+// else (a notification, with no ID) goes to handleNotification.
+func (c *Client) readLoop() {
+	for {
+		line, err := c.reader.ReadBytes('\n')
+		if err != nil {
+			select {
+			case <-c.closed:
+				// Close was already called deliberately; this is expected, not a
+				// connectivity failure worth reporting.
+			default:
+				log.Println("Stratum connection read error: " + err.Error())
+				if c.OnDisconnect != nil {
+					c.OnDisconnect(err)
+				}
+			}
+			c.Close()
+			return
+		}
+		var resp rpcResponse
+		if err := json.Unmarshal(line, &resp); err != nil {
+			continue
+		}
+		if resp.ID != nil {
+			c.pendingMu.Lock()
+			respCh, ok := c.pending[*resp.ID]
+			c.pendingMu.Unlock()
+			if ok {
+				respCh <- resp
+			}
+			continue
+		}
+		if resp.Method != "" {
+			c.handleNotification(resp)
+		}
+	}
+}
+
+// handleNotification dispatches mining.notify and mining.set_difficulty messages to
+// the registered callbacks.
+func (c *Client) handleNotification(resp rpcResponse) {
+	switch resp.Method {
+	case "mining.notify":
+		var params []interface{}
+		if err := json.Unmarshal(resp.Params, &params); err != nil || len(params) < 9 {
+			return
+		}
+		job := Job{
+			JobID:     fmt.Sprint(params[0]),
+			PrevHash:  fmt.Sprint(params[1]),
+			CoinBase1: fmt.Sprint(params[2]),
+			CoinBase2: fmt.Sprint(params[3]),
+			Version:   fmt.Sprint(params[5]),
+			NBits:     fmt.Sprint(params[6]),
+			NTime:     fmt.Sprint(params[7]),
+		}
+		if branches, ok := params[4].([]interface{}); ok {
+			for _, b := range branches {
+				job.MerkleBranches = append(job.MerkleBranches, fmt.Sprint(b))
+			}
+		}
+		if clean, ok := params[8].(bool); ok {
+			job.CleanJobs = clean
+		}
+		if c.OnNotify != nil {
+			c.OnNotify(job)
+		}
+	case "mining.set_difficulty":
+		var params []float64
+		if err := json.Unmarshal(resp.Params, &params); err != nil || len(params) < 1 {
+			return
+		}
+		c.mu.Lock()
+		c.difficulty = params[0]
+		c.mu.Unlock()
+		if c.OnSetDifficulty != nil {
+			c.OnSetDifficulty(params[0])
+		}
+	}
+}
+
+// Difficulty returns the current share difficulty set by the pool.
+func (c *Client) Difficulty() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.difficulty
+}
+
+// RunDuration reports how much time has passed since the given instant (e.g. when
+// Connect was called), for use in stats reporting. The client does not record its
+// own connection time.
+func (c *Client) RunDuration(since time.Time) time.Duration {
+	return time.Since(since)
+}